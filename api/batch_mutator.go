@@ -20,14 +20,30 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/continusec/verifiabledatastructures/logging"
+	"github.com/continusec/verifiabledatastructures/metrics"
 	"github.com/continusec/verifiabledatastructures/pb"
+	"github.com/continusec/verifiabledatastructures/signing"
 	"github.com/golang/protobuf/proto"
 )
 
+// errLeaseLost is returned internally by handleBatch when the Elector-backed
+// lease for a namespace is lost mid-batch. It never escapes consume().
+var errLeaseLost = errors.New("api: lease lost mid-batch")
+
+// errWitnessQuorumNotMet is returned internally by stampHeads when fewer
+// than Conf.WitnessQuorum witnesses cosigned a tree head. It never escapes
+// consume() - unlike other ExecuteUpdate failures, it's treated as
+// recoverable: a witness being transiently unreachable shouldn't take down
+// the whole replica, so the batch is retried instead of going to fatal.
+var errWitnessQuorumNotMet = errors.New("api: witness quorum not met for tree head")
+
 // BatchMutatorConfig has configuration data for a batch mutator service
 type BatchMutatorConfig struct {
 	// Writer is the underlying database to write to
@@ -41,21 +57,69 @@ type BatchMutatorConfig struct {
 
 	// BufferSize is how big a channel to hold mutations before blocking
 	BufferSize int
+
+	// Elector is optional. When set, the mutator campaigns for leadership
+	// of each namespace before writing to it, so that multiple replicas of
+	// this process can run against the same Writer (e.g. a distributedkv
+	// backend) without violating the single-writer-per-namespace
+	// invariant. When nil, this process is always the writer, as before.
+	Elector Elector
+
+	// Signers, if non-empty, are used to stamp every tree head the
+	// mutator writes with a signature over its canonical serialization.
+	// Overlapping keys (e.g. during a rotation) just means listing more
+	// than one Signer here.
+	Signers []signing.Signer
+
+	// Witnesses, if non-empty, are asked to cosign every tree head the
+	// mutator writes. WitnessQuorum of them must succeed or the write is
+	// aborted, giving split-view resistance.
+	Witnesses     []signing.Witness
+	WitnessQuorum int
+
+	// Logger is optional. When set, it replaces the log.Printf/log.Fatal
+	// calls this mutator otherwise makes directly, so operators can swap
+	// in structured logging and adjust verbosity per namespace at runtime
+	// (see the logging package). When nil, the standard log package is
+	// used, as before.
+	Logger logging.Logger
+}
+
+// fatal reports err for ns and terminates the process, via bm.Conf.Logger
+// if one is configured or the standard log package otherwise.
+func (bm *batchMutatorImpl) fatal(ns []byte, msg string, err error) {
+	if bm.Conf.Logger != nil {
+		bm.Conf.Logger.Fatalw(ns, msg, "error", err)
+		return
+	}
+	log.Fatal(err)
 }
 
 // CreateBatchMutator creates a mutator for the given database that batches stuff up and periodically writes it
 func CreateBatchMutator(conf *BatchMutatorConfig) MutatorService {
+	ctx, cancel := context.WithCancel(context.Background())
 	rv := &batchMutatorImpl{
-		Conf: conf,
-		Ch:   make(chan *chObject, conf.BufferSize),
+		Conf:   conf,
+		Ch:     make(chan *chObject, conf.BufferSize),
+		ctx:    ctx,
+		cancel: cancel,
 	}
 	go rv.consume()
 	return rv
 }
 
+// Close cancels any namespace-leadership campaign this mutator currently
+// has in progress (or will start) with Conf.Elector, so a shutting-down
+// replica doesn't sit blocked trying to become leader. It does not wait
+// for an in-flight batch to finish committing.
+func (bm *batchMutatorImpl) Close() {
+	bm.cancel()
+}
+
 type chObject struct {
-	ns  []byte
-	mut *pb.Mutation
+	ns         []byte
+	mut        *pb.Mutation
+	enqueuedAt time.Time
 }
 
 type op struct {
@@ -72,6 +136,12 @@ type mapNoLockDB struct {
 type batchMutatorImpl struct {
 	Conf *BatchMutatorConfig
 	Ch   chan *chObject
+
+	// ctx is cancelled by Close, so a Campaign in progress against
+	// Conf.Elector can be interrupted on shutdown instead of blocking
+	// forever.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // It must return nil, ErrNoSuchKey if none found
@@ -101,32 +171,56 @@ func (m *mapNoLockDB) Set(bucket, key []byte, value proto.Message) error {
 	return nil
 }
 
-// Keep reading and apply until timeout or any other reason
-func (bm *batchMutatorImpl) handleBatch(kw KeyWriter, startSize int64, seed *chObject) (int64, *chObject, error) {
+// Keep reading and apply until timeout, lease loss, or any other reason.
+// On lease loss, the objects applied to kw so far (which the caller must
+// not commit) are returned in pending so that the caller can retry them
+// the next time this replica holds the lease.
+func (bm *batchMutatorImpl) handleBatch(kw KeyWriter, startSize int64, seed *chObject, done <-chan struct{}) (int64, *chObject, []*chObject, error) {
 	curSize := startSize
 	var err error
 	obj := seed
 	var ok bool
 	cnt := bm.Conf.BatchSize
+	var pending []*chObject
 	for {
 		if !bytes.Equal(seed.ns, obj.ns) {
-			return curSize, seed, nil
+			return curSize, seed, pending, nil
 		}
 		curSize, err = ApplyMutation(kw, curSize, obj.mut)
+		mt := mutationType(obj.mut)
 		if err != nil {
-			return 0, nil, err
+			metrics.MutationsFailed.WithLabelValues(mt).Inc()
+			return 0, nil, nil, err
+		}
+		metrics.MutationsApplied.WithLabelValues(mt).Inc()
+		metrics.ApplyLag.Set(time.Since(obj.enqueuedAt).Seconds())
+		pending = append(pending, obj)
+
+		// Only check for lease loss once obj is applied to kw and safely
+		// recorded in pending - checking this before obj is applied (as an
+		// earlier version of this code did) meant a lease lost on the very
+		// first iteration returned obj nowhere: not in pending, and not as
+		// the next seed, so the mutation vanished instead of being
+		// re-queued by consume().
+		select {
+		case <-done:
+			return curSize, nil, pending, errLeaseLost
+		default:
 		}
+
 		cnt--
 		if cnt == 0 {
-			return curSize, nil, nil
+			return curSize, nil, pending, nil
 		}
 		select {
 		case obj, ok = <-bm.Ch:
 			if !ok {
-				return curSize, nil, nil
+				return curSize, nil, pending, nil
 			}
 		case <-time.After(bm.Conf.Timeout):
-			return curSize, nil, nil
+			return curSize, nil, pending, nil
+		case <-done:
+			return curSize, nil, pending, errLeaseLost
 		}
 	}
 }
@@ -135,20 +229,59 @@ func (bm *batchMutatorImpl) consume() {
 	var err error
 	var seed *chObject
 	var ok bool
+
+	// retryQueue holds batches that were applied but never committed -
+	// lease lost mid-batch, or a witness quorum that wasn't met - and so
+	// need to be retried. Each new batch takes its seed from retryQueue
+	// before reading bm.Ch; the rest of that batch is read from bm.Ch, so
+	// a retried mutation can be applied after ones queued later than it.
+	// It's a plain unbounded slice rather than a send back onto bm.Ch: this
+	// goroutine is bm.Ch's only reader, so a send back onto a channel
+	// that's already near Conf.BufferSize (the expected state under
+	// load, which is exactly when a lease is likeliest to be lost) would
+	// block forever with nobody left to drain it.
+	var retryQueue []*chObject
+
 	for {
 		if seed == nil {
-			seed, ok = <-bm.Ch
-			if !ok {
-				return
+			if len(retryQueue) > 0 {
+				seed, retryQueue = retryQueue[0], retryQueue[1:]
+			} else {
+				seed, ok = <-bm.Ch
+				if !ok {
+					return
+				}
 			}
 		}
 
+		ns := seed.ns
+		batchStart := time.Now()
+
+		// When an Elector is configured, only the replica holding the
+		// lease for ns is allowed to write to it. done is closed if
+		// that lease is lost before this batch is committed. bm.ctx
+		// is cancelled by Close, so a campaign in progress can be
+		// interrupted on shutdown instead of blocking forever.
+		var lease Lease
+		var done <-chan struct{}
+		if bm.Conf.Elector != nil {
+			lease, err = bm.Conf.Elector.Campaign(bm.ctx, ns)
+			if err != nil {
+				if bm.ctx.Err() != nil {
+					// Close interrupted the campaign: stop consuming.
+					return
+				}
+				bm.fatal(ns, "failed to campaign for namespace leadership", err)
+			}
+			done = lease.Done()
+		}
+
 		wrapper := &mapNoLockDB{
 			M: make(map[string][]byte),
 		}
 		var startSize, nextSize int64
+		var pending []*chObject
 
-		ns := seed.ns
 		err := bm.Conf.Writer.ExecuteReadOnly(ns, func(kr KeyReader) error {
 			wrapper.Parent = kr
 
@@ -157,19 +290,38 @@ func (bm *batchMutatorImpl) consume() {
 				return err
 			}
 
-			nextSize, seed, err = bm.handleBatch(wrapper, startSize, seed)
+			nextSize, seed, pending, err = bm.handleBatch(wrapper, startSize, seed, done)
 			if err != nil {
 				return err
 			}
 
 			return nil
 		})
+		if err == errLeaseLost {
+			// Nothing in wrapper has been committed, so it's safe to
+			// retry the in-flight mutations ourselves. This replica
+			// only regains a chance to apply them once it next wins
+			// Conf.Elector's campaign for ns - there is no hand-off
+			// of this in-memory queue to whichever replica actually
+			// won it; that would need the distributedkv backend to
+			// expose a watch/transfer primitive, which it doesn't
+			// today.
+			retryQueue = append(retryQueue, pending...)
+			seed = nil
+			continue
+		}
 		if err != nil {
-			log.Fatal(err)
+			bm.fatal(ns, "failed to read and apply batch", err)
 		}
 
+		metrics.BatchSize.Observe(float64(len(pending)))
+
 		if nextSize > startSize { // save it out
 			err = bm.Conf.Writer.ExecuteUpdate(ns, func(kw KeyWriter) error {
+				err := bm.stampHeads(ns, wrapper.L)
+				if err != nil {
+					return err
+				}
 				for _, o := range wrapper.L {
 					err := kw.Set(o.Bucket, o.Key, o.Value)
 					if err != nil {
@@ -178,15 +330,102 @@ func (bm *batchMutatorImpl) consume() {
 				}
 				return writeObjectSize(kw, nextSize)
 			})
+			if err == errWitnessQuorumNotMet {
+				// A witness being transiently unreachable isn't a
+				// reason to take down this replica - nothing was
+				// committed, so it's safe to retry the batch once
+				// quorum is reachable again.
+				if bm.Conf.Logger != nil {
+					bm.Conf.Logger.Errorw(ns, "witness quorum not met, will retry batch", "error", err)
+				} else {
+					log.Printf("witness quorum not met for namespace %x, will retry batch: %v", ns, err)
+				}
+				retryQueue = append(retryQueue, pending...)
+				if lease != nil {
+					if relErr := lease.Release(); relErr != nil {
+						bm.fatal(ns, "failed to release namespace lease", relErr)
+					}
+				}
+				seed = nil
+				continue
+			}
 			if err != nil {
-				log.Fatal(err)
+				bm.fatal(ns, "failed to commit batch", err)
 			}
+			metrics.BatchApplyDuration.Observe(time.Since(batchStart).Seconds())
 		}
+
+		if lease != nil {
+			err = lease.Release()
+			if err != nil {
+				bm.fatal(ns, "failed to release namespace lease", err)
+			}
+		}
+	}
+}
+
+// stampHeads signs every pb.LogTreeHashResponse among ops with bm.Conf.Signers
+// and, if configured, collects cosignatures from bm.Conf.Witnesses, failing
+// with errWitnessQuorumNotMet if fewer than WitnessQuorum of them succeed.
+// ns is used as the log ID in the canonical serialization that's signed.
+// It's a no-op if neither Signers nor Witnesses are configured, so existing
+// deployments that don't opt in see no change in behavior.
+func (bm *batchMutatorImpl) stampHeads(ns []byte, ops []*op) error {
+	if len(bm.Conf.Signers) == 0 && len(bm.Conf.Witnesses) == 0 {
+		return nil
 	}
+
+	now := time.Now()
+	for _, o := range ops {
+		head, ok := o.Value.(*pb.LogTreeHashResponse)
+		if !ok {
+			continue
+		}
+
+		head.Timestamp = now.UnixNano()
+		data := signing.CanonicalTreeHead(ns, head.TreeSize, head.RootHash, head.Timestamp)
+
+		for _, s := range bm.Conf.Signers {
+			sig, err := s.Sign(data)
+			if err != nil {
+				return err
+			}
+			head.Signatures = append(head.Signatures, &pb.TreeHeadSignature{
+				KeyId:     s.KeyID(),
+				Signature: sig,
+			})
+		}
+
+		if len(bm.Conf.Witnesses) > 0 {
+			quorum := 0
+			for _, w := range bm.Conf.Witnesses {
+				sig, err := w.Cosign(data)
+				if err != nil {
+					if bm.Conf.Logger != nil {
+						bm.Conf.Logger.Errorw(ns, "witness failed to cosign tree head", "witness", w.Name(), "error", err)
+					} else {
+						log.Printf("witness %s failed to cosign tree head: %v", w.Name(), err)
+					}
+					continue
+				}
+				head.Signatures = append(head.Signatures, &pb.TreeHeadSignature{
+					KeyId:     sig.KeyID,
+					Signature: sig.Signature,
+				})
+				quorum++
+			}
+			if quorum < bm.Conf.WitnessQuorum {
+				return errWitnessQuorumNotMet
+			}
+		}
+	}
+	return nil
 }
 
 // QueueMutation applies the mutation, normally asynchronously, but synchronously for the InstantMutator
 func (bm *batchMutatorImpl) QueueMutation(ns []byte, mut *pb.Mutation) error {
-	bm.Ch <- &chObject{ns: ns, mut: mut}
+	metrics.MutationsQueued.WithLabelValues(mutationType(mut)).Inc()
+	bm.Ch <- &chObject{ns: ns, mut: mut, enqueuedAt: time.Now()}
+	metrics.QueueDepth.Set(float64(len(bm.Ch)))
 	return nil
 }
@@ -0,0 +1,47 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package api
+
+import "context"
+
+// Elector lets multiple replicas of a batch mutator agree on a single
+// writer per namespace, so that the "single writer per namespace"
+// invariant ApplyMutation/readObjectSize/writeObjectSize relies on holds
+// even when several processes are running behind a load balancer. An
+// Elector is backed by a distributed KV store such as etcd or Consul -
+// see the distributedkv package for implementations.
+type Elector interface {
+	// Campaign blocks until this process becomes leader for ns, or ctx
+	// is cancelled, in which case it returns ctx.Err(). The returned
+	// Lease is held until it is lost or explicitly released.
+	Campaign(ctx context.Context, ns []byte) (Lease, error)
+}
+
+// Lease represents leadership of a single namespace, acquired from an
+// Elector.
+type Lease interface {
+	// Done is closed when the lease is lost, either because it expired
+	// without being renewed in time or because another replica took
+	// over. Callers must stop writing as soon as Done is closed.
+	Done() <-chan struct{}
+
+	// Release gives up the lease voluntarily, allowing another replica
+	// to become leader immediately instead of waiting for expiry.
+	Release() error
+}
@@ -20,22 +20,52 @@ package api
 
 import (
 	"log"
+	"time"
 
+	"github.com/continusec/verifiabledatastructures/logging"
+	"github.com/continusec/verifiabledatastructures/metrics"
 	"github.com/continusec/verifiabledatastructures/pb"
 	"github.com/golang/protobuf/proto"
 )
 
 type InstantMutator struct {
 	Writer StorageWriter
+
+	// Logger is optional. When set, it replaces the log.Printf calls this
+	// mutator otherwise makes directly. When nil, the standard log
+	// package is used, as before.
+	Logger logging.Logger
 }
 
 func (m *InstantMutator) QueueMutation(ns []byte, mut *pb.Mutation) (MutatorPromise, error) {
-	return &instancePromise{Err: m.Writer.ExecuteUpdate(ns, func(kw KeyWriter) error {
+	mt := mutationType(mut)
+	metrics.MutationsQueued.WithLabelValues(mt).Inc()
+
+	start := time.Now()
+	if m.Logger != nil {
+		m.Logger.Debugw(ns, "instant mutation start", "mutation", proto.CompactTextString(mut))
+	} else {
 		log.Printf("Instant mutation start: %s\n", proto.CompactTextString(mut))
-		rv := ApplyMutation(kw, mut)
-		log.Printf("Instant mutation end: %s\n", rv)
-		return rv
-	})}, nil
+	}
+
+	err := m.Writer.ExecuteUpdate(ns, func(kw KeyWriter) error {
+		return ApplyMutation(kw, mut)
+	})
+
+	metrics.ApplyLag.Set(time.Since(start).Seconds())
+	if err != nil {
+		metrics.MutationsFailed.WithLabelValues(mt).Inc()
+	} else {
+		metrics.MutationsApplied.WithLabelValues(mt).Inc()
+	}
+
+	if m.Logger != nil {
+		m.Logger.Debugw(ns, "instant mutation end", "error", err)
+	} else {
+		log.Printf("Instant mutation end: %s\n", err)
+	}
+
+	return &instancePromise{Err: err}, nil
 }
 
 type instancePromise struct {
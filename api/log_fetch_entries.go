@@ -0,0 +1,58 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package api
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/continusec/verifiabledatastructures/pb"
+)
+
+// LogFetchEntries reads the half-open range [req.First, req.Last) from the
+// log and invokes emit once per entry, in order. Unlike the other LocalService
+// methods it does not return a single response message - this lets transports
+// such as gRPC stream entries to the caller as they are read, instead of
+// buffering the whole range in memory.
+func (s *LocalService) LogFetchEntries(ctx context.Context, req *pb.LogFetchEntriesRequest, emit func(*pb.LeafData) error) error {
+	err := s.verifyAccessForLog(req.Log, pb.Permission_PERM_LOG_READ_ENTRY)
+	if err != nil {
+		return err
+	}
+	if req.First < 0 || req.Last < req.First {
+		return ErrInvalidRequest
+	}
+
+	ns, err := logBucket(req.Log)
+	if err != nil {
+		return ErrInvalidRequest
+	}
+	return s.Reader.ExecuteReadOnly(ns, func(kr KeyReader) error {
+		for idx := req.First; idx < req.Last; idx++ {
+			entry, err := lookupLogEntry(kr, req.Log.LogType, idx)
+			if err != nil {
+				return err
+			}
+			err = emit(entry)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
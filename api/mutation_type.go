@@ -0,0 +1,40 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package api
+
+import "github.com/continusec/verifiabledatastructures/pb"
+
+// mutationType returns a short label for mut's metrics, e.g.
+// MutationsQueued{mutation_type=...}.
+func mutationType(mut *pb.Mutation) string {
+	switch {
+	case mut.LogCreate != nil:
+		return "log_create"
+	case mut.LogAddEntry != nil:
+		return "log_add_entry"
+	case mut.LogDestroy != nil:
+		return "log_destroy"
+	case mut.MapSetValue != nil:
+		return "map_set_value"
+	case mut.MapDestroy != nil:
+		return "map_destroy"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,106 @@
+/*
+   Copyright 2017 Continusec Pty Ltd
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/continusec/verifiabledatastructures/signing"
+)
+
+// Client makes authenticated HTTP requests against a VerifiableDataStructures
+// server's JSON/REST API. VerifiableMap and VerifiableLog objects are built
+// on top of it via WithChildPath, one per resource path.
+type Client struct {
+	// BaseURL is the full URL for this resource, e.g.
+	// "https://api.example.com/v1/account/1/log/mylog".
+	BaseURL string
+
+	// Account and APIKey authenticate every request this Client makes.
+	Account string
+	APIKey  string
+
+	// HTTPClient is optional; http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+
+	// KeySet is optional. When set, TreeHead calls made through this
+	// Client verify the signatures on every head returned against it,
+	// requiring at least Quorum distinct keys to have signed - see
+	// VerifyTreeHead. When nil, no verification is performed, as before.
+	KeySet *signing.KeySet
+	Quorum int
+}
+
+// NewClient returns a Client rooted at baseURL, authenticating as account
+// with apiKey.
+func NewClient(baseURL, account, apiKey string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		Account: account,
+		APIKey:  apiKey,
+	}
+}
+
+// WithChildPath returns a Client for a sub-resource of this one, sharing
+// its account, API key and verification config.
+func (c *Client) WithChildPath(path string) *Client {
+	return &Client{
+		BaseURL:    c.BaseURL + path,
+		Account:    c.Account,
+		APIKey:     c.APIKey,
+		HTTPClient: c.HTTPClient,
+		KeySet:     c.KeySet,
+		Quorum:     c.Quorum,
+	}
+}
+
+// MakeRequest issues method against path relative to c.BaseURL, with data as
+// the request body if non-nil and extraHeaders set on the request in
+// addition to the Authorization header this Client always sends. It
+// returns the response body and headers.
+func (c *Client) MakeRequest(method, path string, data []byte, extraHeaders [][2]string) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%s %s", c.Account, c.APIKey))
+	for _, h := range extraHeaders {
+		req.Header.Set(h[0], h[1])
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("client: unexpected status %d: %s", resp.StatusCode, contents)
+	}
+	return contents, resp.Header, nil
+}
@@ -0,0 +1,45 @@
+/*
+   Copyright 2017 Continusec Pty Ltd
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import "github.com/continusec/verifiabledatastructures/signing"
+
+// JSONAddEntryResponse is the JSON body returned by the REST API for a log
+// or map mutation.
+type JSONAddEntryResponse struct {
+	Hash []byte `json:"leaf_hash"`
+}
+
+// JSONLogTreeHeadResponse is the JSON representation of a single log tree
+// head, embedded in JSONMapTreeHeadResponse and returned directly by a
+// log's /tree/<n> endpoint.
+type JSONLogTreeHeadResponse struct {
+	TreeSize int64  `json:"tree_size"`
+	Hash     []byte `json:"tree_hash"`
+
+	// Timestamp and Signatures are only populated when the server has
+	// Signers configured - see VerifyTreeHead.
+	Timestamp  int64                     `json:"timestamp,omitempty"`
+	Signatures []*signing.KeyedSignature `json:"signatures,omitempty"`
+}
+
+// JSONMapTreeHeadResponse is the JSON body returned by a map's /tree/<n>
+// endpoint.
+type JSONMapTreeHeadResponse struct {
+	MapHash     []byte                  `json:"map_hash"`
+	LogTreeHead JSONLogTreeHeadResponse `json:"mutation_log"`
+}
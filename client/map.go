@@ -211,6 +211,14 @@ func (self *verifiableMapImpl) TreeHead(treeSize int64) (*MapTreeHead, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if self.Client.KeySet != nil {
+		err = VerifyTreeHead(self.Client.KeySet, self.Client.Quorum, []byte(self.MapName), cr.LogTreeHead.TreeSize, cr.LogTreeHead.Hash, cr.LogTreeHead.Timestamp, cr.LogTreeHead.Signatures)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &MapTreeHead{
 		RootHash: cr.MapHash,
 		MutationLogTreeHead: LogTreeHead{
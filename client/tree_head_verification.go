@@ -0,0 +1,43 @@
+/*
+   Copyright 2017 Continusec Pty Ltd
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"time"
+
+	"github.com/continusec/verifiabledatastructures/signing"
+)
+
+// ErrTreeHeadVerificationFailed is returned by VerifyTreeHead when fewer
+// than quorum trusted keys produced a valid signature over the head.
+var ErrTreeHeadVerificationFailed = errors.New("client: tree head signature verification failed")
+
+// VerifyTreeHead checks that sigs contains valid, unexpired signatures
+// from at least quorum distinct keys in keys over the canonical
+// serialization of (logID, treeSize, rootHash, timestamp). Callers that
+// configure a KeySet should call this on every LogTreeHead/MapTreeHead
+// the server returns before trusting it - a log operator that can't
+// produce a quorum of signatures for a given head may be attempting a
+// split view.
+func VerifyTreeHead(keys *signing.KeySet, quorum int, logID []byte, treeSize int64, rootHash []byte, timestamp int64, sigs []*signing.KeyedSignature) error {
+	data := signing.CanonicalTreeHead(logID, treeSize, rootHash, timestamp)
+	if keys.CountValid(data, sigs, time.Now()) < quorum {
+		return ErrTreeHeadVerificationFailed
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package distributedkv
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	consulapi "github.com/hashicorp/consul/api"
+
+	"github.com/continusec/verifiabledatastructures/api"
+)
+
+// ConsulStorageConfig configures a ConsulStorage.
+type ConsulStorageConfig struct {
+	// Client is a connected Consul client, shared with any Elector used
+	// alongside this storage.
+	Client *consulapi.Client
+
+	// Prefix namespaces all keys this instance writes under the Consul KV
+	// store, so that a single Consul cluster can be shared by more than
+	// one deployment.
+	Prefix string
+
+	// SessionTTL is how long a per-namespace election session is held
+	// before it must be renewed. Used by NewElector.
+	SessionTTL time.Duration
+}
+
+// ConsulStorage is an api.StorageReader and api.StorageWriter backed by the
+// Consul KV store. Reads are served from any cluster member; writes are
+// applied with a single KV transaction per ExecuteUpdate batch.
+type ConsulStorage struct {
+	Conf *ConsulStorageConfig
+}
+
+// NewElector returns an api.Elector that campaigns for per-namespace
+// leadership using a Consul session and the KV store's lock semantics.
+func (c *ConsulStorage) NewElector() api.Elector {
+	return &consulElector{conf: c.Conf}
+}
+
+func (c *ConsulStorage) key(ns, bucket, key []byte) string {
+	return c.Conf.Prefix + "/" + hex.EncodeToString(ns) + "/" + hex.EncodeToString(bucket) + "/" + hex.EncodeToString(key)
+}
+
+// ExecuteReadOnly satisfies api.StorageReader.
+func (c *ConsulStorage) ExecuteReadOnly(ns []byte, f func(api.KeyReader) error) error {
+	return f(&consulReader{storage: c, ns: ns})
+}
+
+// ExecuteUpdate satisfies api.StorageWriter. All Set calls made by f are
+// buffered and applied as a single Consul KV transaction once f returns.
+func (c *ConsulStorage) ExecuteUpdate(ns []byte, f func(api.KeyWriter) error) error {
+	kw := &consulWriter{consulReader: consulReader{storage: c, ns: ns}}
+	err := f(kw)
+	if err != nil {
+		return err
+	}
+	if len(kw.ops) == 0 {
+		return nil
+	}
+	ok, _, _, err := c.Conf.Client.KV().Txn(kw.ops, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("distributedkv: consul transaction rolled back")
+	}
+	return nil
+}
+
+type consulReader struct {
+	storage *ConsulStorage
+	ns      []byte
+}
+
+// Get satisfies api.KeyReader. It returns ErrNoSuchKey if bucket/key is absent.
+func (r *consulReader) Get(bucket, key []byte, value proto.Message) error {
+	pair, _, err := r.storage.Conf.Client.KV().Get(r.storage.key(r.ns, bucket, key), nil)
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		return ErrNoSuchKey
+	}
+	return proto.Unmarshal(pair.Value, value)
+}
+
+type consulWriter struct {
+	consulReader
+	ops consulapi.KVTxnOps
+}
+
+// Set satisfies api.KeyWriter. A nil value deletes bucket/key.
+func (w *consulWriter) Set(bucket, key []byte, value proto.Message) error {
+	k := w.storage.key(w.ns, bucket, key)
+	if value == nil {
+		w.ops = append(w.ops, &consulapi.KVTxnOp{Verb: consulapi.KVDelete, Key: k})
+		return nil
+	}
+	b, err := proto.Marshal(value)
+	if err != nil {
+		return err
+	}
+	w.ops = append(w.ops, &consulapi.KVTxnOp{Verb: consulapi.KVSet, Key: k, Value: b})
+	return nil
+}
+
+type consulElector struct {
+	conf *ConsulStorageConfig
+}
+
+func (e *consulElector) Campaign(ctx context.Context, ns []byte) (api.Lease, error) {
+	sessionID, _, err := e.conf.Client.Session().Create(&consulapi.SessionEntry{
+		TTL:      e.conf.SessionTTL.String(),
+		Behavior: consulapi.SessionBehaviorRelease,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	lockKey := e.conf.Prefix + "/election/" + hex.EncodeToString(ns)
+	lock, err := e.conf.Client.LockOpts(&consulapi.LockOptions{
+		Key:     lockKey,
+		Session: sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// lock.Lock blocks until the lock is acquired or stopCh is closed, so
+	// ctx's cancellation propagates straight through to it.
+	lostCh, err := lock.Lock(ctx.Done())
+	if err != nil {
+		return nil, err
+	}
+	if lostCh == nil {
+		// ctx was cancelled before the lock was acquired.
+		e.conf.Client.Session().Destroy(sessionID, nil)
+		return nil, ctx.Err()
+	}
+	return &consulLease{client: e.conf.Client, sessionID: sessionID, lock: lock, lost: lostCh}, nil
+}
+
+type consulLease struct {
+	client    *consulapi.Client
+	sessionID string
+	lock      *consulapi.Lock
+	lost      <-chan struct{}
+}
+
+// Done is closed when Consul reports that the underlying lock was lost.
+func (l *consulLease) Done() <-chan struct{} {
+	return l.lost
+}
+
+func (l *consulLease) Release() error {
+	err := l.lock.Unlock()
+	_, destroyErr := l.client.Session().Destroy(l.sessionID, nil)
+	if err != nil {
+		return err
+	}
+	return destroyErr
+}
@@ -0,0 +1,165 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+// Package distributedkv provides StorageReader/StorageWriter and
+// api.Elector implementations backed by a distributed KV store, so that
+// several replicas of a batch mutator can run behind a load balancer
+// without losing the single-writer-per-namespace invariant. It ships
+// drivers for etcd and Consul; reads work against any replica, while
+// writes are gated by the companion Elector.
+package distributedkv
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	clientv3 "go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/concurrency"
+
+	"github.com/continusec/verifiabledatastructures/api"
+)
+
+// ErrNoSuchKey is returned by Get when the requested key is absent, as
+// required by the api.KeyReader contract.
+var ErrNoSuchKey = api.ErrNoSuchKey
+
+// EtcdStorageConfig configures an EtcdStorage.
+type EtcdStorageConfig struct {
+	// Client is a connected etcd client, shared with any EtcdElector
+	// used alongside this storage.
+	Client *clientv3.Client
+
+	// Prefix namespaces all keys this instance writes, so that a single
+	// etcd cluster can be shared by more than one deployment.
+	Prefix string
+
+	// LeaseTTL is how long a per-namespace election lease is held
+	// before it must be renewed. Used by NewElector.
+	LeaseTTL time.Duration
+}
+
+// EtcdStorage is an api.StorageReader and api.StorageWriter backed by etcd.
+// Reads are served from any cluster member; writes go through etcd
+// transactions so that ExecuteUpdate's batch is applied atomically.
+type EtcdStorage struct {
+	Conf *EtcdStorageConfig
+}
+
+// NewElector returns an api.Elector that campaigns for per-namespace
+// leadership using etcd's concurrency package. Namespace leases are held
+// for Conf.LeaseTTL and renewed automatically until Release is called or
+// the underlying session drops.
+func (e *EtcdStorage) NewElector() api.Elector {
+	return &etcdElector{conf: e.Conf}
+}
+
+func (e *EtcdStorage) key(ns, bucket, key []byte) string {
+	return e.Conf.Prefix + "/" + hex.EncodeToString(ns) + "/" + hex.EncodeToString(bucket) + "/" + hex.EncodeToString(key)
+}
+
+// ExecuteReadOnly satisfies api.StorageReader.
+func (e *EtcdStorage) ExecuteReadOnly(ns []byte, f func(api.KeyReader) error) error {
+	return f(&etcdReader{storage: e, ns: ns})
+}
+
+// ExecuteUpdate satisfies api.StorageWriter. All Set calls made by f are
+// buffered and applied as a single etcd transaction once f returns.
+func (e *EtcdStorage) ExecuteUpdate(ns []byte, f func(api.KeyWriter) error) error {
+	kw := &etcdWriter{etcdReader: etcdReader{storage: e, ns: ns}}
+	err := f(kw)
+	if err != nil {
+		return err
+	}
+	if len(kw.ops) == 0 {
+		return nil
+	}
+	txn := e.Conf.Client.Txn(context.Background())
+	_, err = txn.Then(kw.ops...).Commit()
+	return err
+}
+
+type etcdReader struct {
+	storage *EtcdStorage
+	ns      []byte
+}
+
+// Get satisfies api.KeyReader. It returns ErrNoSuchKey if bucket/key is absent.
+func (r *etcdReader) Get(bucket, key []byte, value proto.Message) error {
+	resp, err := r.storage.Conf.Client.Get(context.Background(), r.storage.key(r.ns, bucket, key))
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return ErrNoSuchKey
+	}
+	return proto.Unmarshal(resp.Kvs[0].Value, value)
+}
+
+type etcdWriter struct {
+	etcdReader
+	ops []clientv3.Op
+}
+
+// Set satisfies api.KeyWriter. A nil value deletes bucket/key.
+func (w *etcdWriter) Set(bucket, key []byte, value proto.Message) error {
+	k := w.storage.key(w.ns, bucket, key)
+	if value == nil {
+		w.ops = append(w.ops, clientv3.OpDelete(k))
+		return nil
+	}
+	b, err := proto.Marshal(value)
+	if err != nil {
+		return err
+	}
+	w.ops = append(w.ops, clientv3.OpPut(k, string(b)))
+	return nil
+}
+
+type etcdElector struct {
+	conf *EtcdStorageConfig
+}
+
+func (e *etcdElector) Campaign(ctx context.Context, ns []byte) (api.Lease, error) {
+	session, err := concurrency.NewSession(e.conf.Client, concurrency.WithTTL(int(e.conf.LeaseTTL/time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	election := concurrency.NewElection(session, e.conf.Prefix+"/election/"+hex.EncodeToString(ns))
+	err = election.Campaign(ctx, hex.EncodeToString(ns))
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &etcdLease{session: session}, nil
+}
+
+type etcdLease struct {
+	session *concurrency.Session
+}
+
+// Done is closed when the underlying etcd session expires or is closed,
+// which is exactly when this replica's election lease is lost.
+func (l *etcdLease) Done() <-chan struct{} {
+	return l.session.Done()
+}
+
+func (l *etcdLease) Release() error {
+	return l.session.Close()
+}
@@ -0,0 +1,94 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+// Package grpcserver exposes a LocalService over gRPC so that clients in
+// trusted networks can avoid the JSON/hex encoding costs of the HTTP
+// transport. Each RPC is a thin adaptor onto the corresponding LocalService
+// method - proofs are returned as fields on the response messages rather
+// than being re-encoded into headers.
+package grpcserver
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/continusec/verifiabledatastructures/api"
+	"github.com/continusec/verifiabledatastructures/pb"
+)
+
+// Wrap returns a pb.VerifiableDataStructuresServer that routes each RPC to
+// the matching method on ls.
+func Wrap(ls *api.LocalService) pb.VerifiableDataStructuresServer {
+	return &server{ls: ls}
+}
+
+type server struct {
+	ls *api.LocalService
+}
+
+func (s *server) LogCreate(ctx context.Context, req *pb.LogCreateRequest) (*pb.LogCreateResponse, error) {
+	return s.ls.LogCreate(ctx, req)
+}
+
+func (s *server) LogTreeHash(ctx context.Context, req *pb.LogTreeHashRequest) (*pb.LogTreeHashResponse, error) {
+	return s.ls.LogTreeHash(ctx, req)
+}
+
+func (s *server) LogAddEntry(ctx context.Context, req *pb.LogAddEntryRequest) (*pb.LogAddEntryResponse, error) {
+	return s.ls.LogAddEntry(ctx, req)
+}
+
+func (s *server) LogDestroy(ctx context.Context, req *pb.LogDestroyRequest) (*pb.LogDestroyResponse, error) {
+	return s.ls.LogDestroy(ctx, req)
+}
+
+func (s *server) LogInclusionProof(ctx context.Context, req *pb.LogInclusionProofRequest) (*pb.LogInclusionProofResponse, error) {
+	return s.ls.LogInclusionProof(ctx, req)
+}
+
+func (s *server) LogConsistencyProof(ctx context.Context, req *pb.LogConsistencyProofRequest) (*pb.LogConsistencyProofResponse, error) {
+	return s.ls.LogConsistencyProof(ctx, req)
+}
+
+func (s *server) MapCreate(ctx context.Context, req *pb.MapCreateRequest) (*pb.MapCreateResponse, error) {
+	return s.ls.MapCreate(ctx, req)
+}
+
+func (s *server) MapDestroy(ctx context.Context, req *pb.MapDestroyRequest) (*pb.MapDestroyResponse, error) {
+	return s.ls.MapDestroy(ctx, req)
+}
+
+func (s *server) MapSetValue(ctx context.Context, req *pb.MapSetValueRequest) (*pb.MapSetValueResponse, error) {
+	return s.ls.MapSetValue(ctx, req)
+}
+
+func (s *server) MapGetValue(ctx context.Context, req *pb.MapGetValueRequest) (*pb.MapGetValueResponse, error) {
+	return s.ls.MapGetValue(ctx, req)
+}
+
+func (s *server) MapTreeHash(ctx context.Context, req *pb.MapTreeHashRequest) (*pb.MapTreeHashResponse, error) {
+	return s.ls.MapTreeHash(ctx, req)
+}
+
+// LogFetchEntries streams entries back to the client as they are read,
+// rather than buffering the whole range in memory as the HTTP transport
+// does.
+func (s *server) LogFetchEntries(req *pb.LogFetchEntriesRequest, stream pb.VerifiableDataStructures_LogFetchEntriesServer) error {
+	return s.ls.LogFetchEntries(stream.Context(), req, func(entry *pb.LeafData) error {
+		return stream.Send(entry)
+	})
+}
@@ -0,0 +1,56 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package logging
+
+import (
+	"encoding/hex"
+	"net/http"
+)
+
+// AdminHandler returns an http.Handler that lets operators change a
+// ZapLogger's log level at runtime without restarting the process. A PUT
+// to ?level=debug|info|error sets the level for the namespace named by the
+// hex-encoded ?ns= query param, or the default level if ns is omitted.
+func AdminHandler(z *ZapLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "only PUT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		level, ok := ParseLevel(r.URL.Query().Get("level"))
+		if !ok {
+			http.Error(w, "level must be one of debug, info, error", http.StatusBadRequest)
+			return
+		}
+
+		var ns []byte
+		if nsParam := r.URL.Query().Get("ns"); nsParam != "" {
+			var err error
+			ns, err = hex.DecodeString(nsParam)
+			if err != nil {
+				http.Error(w, "ns must be hex-encoded", http.StatusBadRequest)
+				return
+			}
+		}
+
+		z.SetNamespaceLevel(ns, level)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,73 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+// Package logging gives the mutator pipeline a structured logger to write
+// to instead of calling log.Printf/log.Fatal directly, so operators running
+// long-lived services can raise or lower verbosity per namespace at
+// runtime (see AdminHandler) instead of restarting to change it.
+package logging
+
+// Logger is the structured logging interface the mutator pipeline depends
+// on. Implementations should be safe for concurrent use.
+type Logger interface {
+	Debugw(ns []byte, msg string, keysAndValues ...interface{})
+	Infow(ns []byte, msg string, keysAndValues ...interface{})
+	Errorw(ns []byte, msg string, keysAndValues ...interface{})
+
+	// Fatalw logs regardless of the configured level and then terminates
+	// the process, same as the log.Fatal calls it replaces.
+	Fatalw(ns []byte, msg string, keysAndValues ...interface{})
+}
+
+// Level is a logging verbosity level, ordered from most to least verbose.
+type Level int
+
+// The supported Levels, ordered from most to least verbose.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	ErrorLevel
+)
+
+// ParseLevel converts a level name such as "debug" to a Level. It returns
+// false if s doesn't name a known Level.
+func ParseLevel(s string) (Level, bool) {
+	switch s {
+	case "debug":
+		return DebugLevel, true
+	case "info":
+		return InfoLevel, true
+	case "error":
+		return ErrorLevel, true
+	default:
+		return 0, false
+	}
+}
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case ErrorLevel:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
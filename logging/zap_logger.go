@@ -0,0 +1,92 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package logging
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// ZapLogger is a Logger backed by a *zap.SugaredLogger, with a log level
+// that can be overridden per namespace at runtime via SetNamespaceLevel (or
+// AdminHandler).
+type ZapLogger struct {
+	base *zap.SugaredLogger
+
+	mu           sync.RWMutex
+	defaultLevel Level
+	levels       map[string]Level
+}
+
+// NewZapLogger wraps base, logging at defaultLevel for any namespace that
+// hasn't had SetNamespaceLevel called for it.
+func NewZapLogger(base *zap.Logger, defaultLevel Level) *ZapLogger {
+	return &ZapLogger{
+		base:         base.Sugar(),
+		defaultLevel: defaultLevel,
+		levels:       make(map[string]Level),
+	}
+}
+
+// SetNamespaceLevel overrides the log level for ns. Pass a nil ns to
+// change the default level for namespaces with no override.
+func (z *ZapLogger) SetNamespaceLevel(ns []byte, level Level) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if ns == nil {
+		z.defaultLevel = level
+		return
+	}
+	z.levels[hex.EncodeToString(ns)] = level
+}
+
+func (z *ZapLogger) levelFor(ns []byte) Level {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if level, ok := z.levels[hex.EncodeToString(ns)]; ok {
+		return level
+	}
+	return z.defaultLevel
+}
+
+func (z *ZapLogger) Debugw(ns []byte, msg string, keysAndValues ...interface{}) {
+	if z.levelFor(ns) <= DebugLevel {
+		z.base.Debugw(msg, keysAndValues...)
+	}
+}
+
+func (z *ZapLogger) Infow(ns []byte, msg string, keysAndValues ...interface{}) {
+	if z.levelFor(ns) <= InfoLevel {
+		z.base.Infow(msg, keysAndValues...)
+	}
+}
+
+func (z *ZapLogger) Errorw(ns []byte, msg string, keysAndValues ...interface{}) {
+	if z.levelFor(ns) <= ErrorLevel {
+		z.base.Errorw(msg, keysAndValues...)
+	}
+}
+
+// Fatalw always logs, regardless of the configured level, then terminates
+// the process - it's replacing a log.Fatal call, not a log.Print one.
+func (z *ZapLogger) Fatalw(ns []byte, msg string, keysAndValues ...interface{}) {
+	z.base.Fatalw(msg, keysAndValues...)
+}
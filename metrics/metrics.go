@@ -0,0 +1,101 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+// Package metrics holds the Prometheus collectors wired into the mutator
+// pipeline (CreateBatchMutator, ApplyMutation, StorageWriter.ExecuteUpdate),
+// so operators get queue depth, batch size, apply latency, and apply lag
+// without having to instrument those call sites themselves. Lag and the
+// counters are not broken down by namespace (see below).
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespaces are account-controlled in a multi-tenant deployment, so none
+// of these collectors label by namespace - an unbounded, caller-chosen
+// label value on a CounterVec/GaugeVec never stops growing for the life of
+// the process. mutation_type is safe to label by: it's drawn from the
+// small, fixed set mutationType returns.
+var (
+	// MutationsQueued counts mutations handed to QueueMutation, labelled
+	// by mutation type.
+	MutationsQueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vds_mutations_queued_total",
+		Help: "Mutations queued with a mutator.",
+	}, []string{"mutation_type"})
+
+	// MutationsApplied counts mutations successfully applied to storage.
+	MutationsApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vds_mutations_applied_total",
+		Help: "Mutations successfully applied by a mutator.",
+	}, []string{"mutation_type"})
+
+	// MutationsFailed counts mutations that failed to apply.
+	MutationsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vds_mutations_failed_total",
+		Help: "Mutations that failed to apply in a mutator.",
+	}, []string{"mutation_type"})
+
+	// BatchSize observes how many mutations ended up in each committed batch.
+	BatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "vds_batch_size",
+		Help:    "Number of mutations per committed batch.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	// BatchApplyDuration observes the wall-clock time to apply and commit a batch.
+	BatchApplyDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "vds_batch_apply_duration_seconds",
+		Help:    "Time taken to apply and commit a batch.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// QueueDepth is the current occupancy of the mutator's buffered channel.
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "vds_queue_depth",
+		Help: "Number of mutations currently buffered in the mutator's channel.",
+	})
+
+	// ApplyLag is the time between a mutation being queued and it being applied.
+	ApplyLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "vds_apply_lag_seconds",
+		Help: "Time between QueueMutation and the mutation being applied.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		MutationsQueued,
+		MutationsApplied,
+		MutationsFailed,
+		BatchSize,
+		BatchApplyDuration,
+		QueueDepth,
+		ApplyLag,
+	)
+}
+
+// RegisterHandler registers the standard Prometheus scrape handler at path
+// on mux, e.g. metrics.RegisterHandler(mux, "/metrics").
+func RegisterHandler(mux *http.ServeMux, path string) {
+	mux.Handle(path, promhttp.Handler())
+}
@@ -64,6 +64,11 @@ func (s *localServiceImpl) LogTreeHash(ctx context.Context, req *pb.LogTreeHashR
 		rv = &pb.LogTreeHashResponse{
 			TreeSize: req.TreeSize,
 			RootHash: m.Mth,
+			// Carry over the signatures the mutator stamped this size
+			// with at write time - a freshly built response with no
+			// Signatures would silently undo that stamping for every
+			// historical/consistency lookup.
+			Signatures: m.Signatures,
 		}
 		return nil
 	})
@@ -0,0 +1,42 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package signing
+
+import "encoding/binary"
+
+// CanonicalTreeHead returns the canonical byte serialization of a tree
+// head that Signers and Witnesses sign over, and that Verifiers check
+// signatures against: logID, followed by the big-endian tree size, the
+// root hash, and the big-endian unix-nano timestamp it was published at.
+func CanonicalTreeHead(logID []byte, treeSize int64, rootHash []byte, timestamp int64) []byte {
+	buf := make([]byte, 0, len(logID)+8+len(rootHash)+8)
+	buf = append(buf, logID...)
+
+	var sizeBuf [8]byte
+	binary.BigEndian.PutUint64(sizeBuf[:], uint64(treeSize))
+	buf = append(buf, sizeBuf[:]...)
+
+	buf = append(buf, rootHash...)
+
+	var tsBuf [8]byte
+	binary.BigEndian.PutUint64(tsBuf[:], uint64(timestamp))
+	buf = append(buf, tsBuf[:]...)
+
+	return buf
+}
@@ -0,0 +1,78 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package signing
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"time"
+)
+
+// ErrWrongKeySize is returned by NewEd25519Signer/NewEd25519Verifier when
+// the supplied key isn't a valid Ed25519 key.
+var ErrWrongKeySize = errors.New("signing: wrong key size for ed25519")
+
+type ed25519Signer struct {
+	keyID string
+	priv  ed25519.PrivateKey
+}
+
+// NewEd25519Signer returns a Signer that signs with priv, identifying
+// itself as keyID in every signature it produces.
+func NewEd25519Signer(keyID string, priv ed25519.PrivateKey) (Signer, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, ErrWrongKeySize
+	}
+	return &ed25519Signer{keyID: keyID, priv: priv}, nil
+}
+
+func (s *ed25519Signer) KeyID() string {
+	return s.keyID
+}
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.priv, data), nil
+}
+
+type ed25519Verifier struct {
+	keyID    string
+	pub      ed25519.PublicKey
+	notAfter time.Time
+}
+
+// NewEd25519Verifier returns a Verifier for the given public key. Pass the
+// zero time.Time for notAfter if the key should be trusted indefinitely.
+func NewEd25519Verifier(keyID string, pub ed25519.PublicKey, notAfter time.Time) (Verifier, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, ErrWrongKeySize
+	}
+	return &ed25519Verifier{keyID: keyID, pub: pub, notAfter: notAfter}, nil
+}
+
+func (v *ed25519Verifier) KeyID() string {
+	return v.keyID
+}
+
+func (v *ed25519Verifier) Verify(data, sig []byte) bool {
+	return ed25519.Verify(v.pub, data, sig)
+}
+
+func (v *ed25519Verifier) NotAfter() time.Time {
+	return v.notAfter
+}
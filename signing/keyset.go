@@ -0,0 +1,81 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package signing
+
+import (
+	"sync"
+	"time"
+)
+
+// KeySet is the verifier-side trust store for tree head signatures. Key
+// rotation needs no flag day: add the new key's Verifier alongside the
+// old one with Add, and the old key stays trusted until its NotAfter
+// passes, so heads signed just before the rotation still verify.
+type KeySet struct {
+	mu        sync.RWMutex
+	verifiers map[string]Verifier
+}
+
+// NewKeySet returns an empty KeySet.
+func NewKeySet() *KeySet {
+	return &KeySet{verifiers: make(map[string]Verifier)}
+}
+
+// Add registers v as a trusted verifier, keyed by v.KeyID(). Adding a
+// verifier for a KeyID that's already present replaces it.
+func (k *KeySet) Add(v Verifier) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.verifiers[v.KeyID()] = v
+}
+
+// Remove drops a previously-trusted key, e.g. once its NotAfter has long
+// passed and it's no longer worth carrying around.
+func (k *KeySet) Remove(keyID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.verifiers, keyID)
+}
+
+// CountValid returns the number of distinct, currently-trusted keys for
+// which sigs contains a signature over data that verifies. Signatures
+// from unknown keys, or from known keys whose NotAfter has passed as of
+// now, are ignored.
+func (k *KeySet) CountValid(data []byte, sigs []*KeyedSignature, now time.Time) int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, sig := range sigs {
+		if seen[sig.KeyID] {
+			continue
+		}
+		v, ok := k.verifiers[sig.KeyID]
+		if !ok {
+			continue
+		}
+		if notAfter := v.NotAfter(); !notAfter.IsZero() && now.After(notAfter) {
+			continue
+		}
+		if v.Verify(data, sig.Signature) {
+			seen[sig.KeyID] = true
+		}
+	}
+	return len(seen)
+}
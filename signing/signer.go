@@ -0,0 +1,56 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+// Package signing lets a log operator stamp every tree head it publishes
+// with one or more signatures, and lets clients and witnesses verify those
+// signatures against a rotating set of trusted keys. See KeySet for how
+// key rotation without a flag day works, and Witness for external
+// cosigning.
+package signing
+
+import "time"
+
+// Signer produces a signature over tree head material on behalf of a
+// single key. Implementations must be safe for concurrent use, since the
+// mutator may stamp heads for several namespaces at once.
+type Signer interface {
+	// KeyID identifies this key in every signature it produces, so
+	// verifiers know which Verifier to check it against.
+	KeyID() string
+
+	// Sign returns a signature over data.
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier checks signatures produced by the Signer holding the matching
+// private key. NotAfter lets a KeySet keep honouring a rotated-out key
+// until every head it may have signed has aged out of the trust window -
+// a zero NotAfter means the key never expires.
+type Verifier interface {
+	KeyID() string
+	Verify(data, sig []byte) bool
+	NotAfter() time.Time
+}
+
+// KeyedSignature pairs a signature with the ID of the key that produced
+// it. It's the transport-agnostic equivalent of pb.TreeHeadSignature, used
+// so this package doesn't need to depend on pb.
+type KeyedSignature struct {
+	KeyID     string
+	Signature []byte
+}
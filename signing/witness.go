@@ -0,0 +1,35 @@
+/*
+
+Copyright 2017 Continusec Pty Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package signing
+
+// Witness lets an operator plug in an external cosigner. The server calls
+// Cosign with the same canonical bytes its own Signers sign over, and
+// aggregates the returned signature into the tree head it publishes. A
+// configurable quorum of witness signatures is what gives split-view
+// resistance: a compromised or misbehaving log operator can't show two
+// different heads at the same tree size without also getting a quorum of
+// independent witnesses to cosign the lie.
+type Witness interface {
+	// Name identifies this witness in logs and error messages.
+	Name() string
+
+	// Cosign returns this witness's signature over data, the canonical
+	// serialization of the tree head being published.
+	Cosign(data []byte) (*KeyedSignature, error)
+}